@@ -29,12 +29,46 @@ import (
 	"github.com/golang/glog"
 )
 
+// CachePolicy selects the eviction strategy used by a listCache.
+type CachePolicy int
+
+const (
+	// PolicyLRU evicts the least-recently-used entry, same as classical LRU.
+	PolicyLRU CachePolicy = iota
+	// PolicySieve evicts using SIEVE, a scan-resistant algorithm that avoids
+	// moving entries on every hit: https://cachemon.github.io/SIEVE-website/.
+	PolicySieve
+)
+
 type shard struct {
-	sync.Mutex
+	sync.RWMutex
 
 	MaxEntries int
+	policy     CachePolicy
 	ll         *list.List
 	cache      map[string]*list.Element
+
+	// hand is SIEVE's eviction pointer. It only advances during eviction and
+	// is nil until the first eviction pass.
+	hand *list.Element
+
+	// admission guards PutIfMissing against polluting a full cache with
+	// newly-fetched, scan-driven entries that are colder than the entry
+	// they'd displace.
+	admission *tinyLFU
+
+	// wheel backs the optional per-key TTL; entries with a zero ttl are never
+	// scheduled on it and so never expire on their own.
+	wheel *timingWheel
+
+	// inflight backs GetOrLoad's singleflight coalescing of concurrent
+	// loads for the same cold key.
+	inflightMu sync.Mutex
+	inflight   map[string]*call
+
+	hits      uint64
+	misses    uint64
+	coalesced uint64
 }
 
 // listCache is an LRU cache.
@@ -42,10 +76,17 @@ type listCache struct {
 	// MaxSize is the maximum size of cache before an item is evicted.
 	// MaxSize    uint64
 	MaxEntries int
+	policy     CachePolicy
 
 	shards []*shard
 	// evicts uint64
 
+	// defaultTTL applies to PutIfMissing calls and to PutIfMissingWithTTL calls
+	// made with ttl <= 0. It's a time.Duration in nanoseconds, accessed via
+	// sync/atomic since SetDefaultTTL can race with concurrent inserts. Zero
+	// means no TTL unless the caller specifies one explicitly.
+	defaultTTL int64
+
 	done int32
 }
 
@@ -58,16 +99,36 @@ type CacheStats struct {
 type entry struct {
 	key string
 	pl  *List
+
+	// visited is SIEVE's retained bit. It is read and written via atomic
+	// operations so that Get can set it without holding the shard lock
+	// exclusively. Unused under PolicyLRU.
+	visited int32
+
+	// ttl is non-zero for entries inserted via PutIfMissingWithTTL; Get uses
+	// it to reschedule the entry's timing-wheel slot (sliding expiration).
+	ttl time.Duration
 }
 
 // New creates a new Cache.
 func newListCache(maxEntries int) *listCache {
-	lc := &listCache{}
+	return newListCacheWithPolicy(maxEntries, PolicyLRU)
+}
+
+// newListCacheWithPolicy creates a new Cache using the given eviction policy.
+// This lets operators A/B test LRU against SIEVE without a restart-time
+// recompile.
+func newListCacheWithPolicy(maxEntries int, policy CachePolicy) *listCache {
+	lc := &listCache{policy: policy}
 	for i := 0; i < 64; i++ {
 		lc.shards = append(lc.shards, &shard{
 			MaxEntries: maxEntries,
+			policy:     policy,
 			ll:         list.New(),
 			cache:      make(map[string]*list.Element),
+			admission:  newTinyLFU(maxEntries),
+			wheel:      newTimingWheel(),
+			inflight:   make(map[string]*call),
 		})
 	}
 
@@ -78,9 +139,18 @@ func newListCache(maxEntries int) *listCache {
 	// }
 
 	go lc.removeOldestLoop()
+	go lc.removeExpiredLoop()
 	return lc
 }
 
+// SetDefaultTTL sets the TTL applied to PutIfMissing calls and to
+// PutIfMissingWithTTL calls that pass ttl <= 0. Passing 0 here disables the
+// default, so entries only expire when
+// callers pass an explicit TTL.
+func (lc *listCache) SetDefaultTTL(ttl time.Duration) {
+	atomic.StoreInt64(&lc.defaultTTL, int64(ttl))
+}
+
 // func (c *listCache) UpdateMaxSize(size int) int {
 // 	c.Lock()
 // 	defer c.Unlock()
@@ -94,28 +164,91 @@ func newListCache(maxEntries int) *listCache {
 
 // Add adds a value to the cache.
 func (lc *listCache) PutIfMissing(key string, pl *List) (res *List) {
+	return lc.putIfMissing(key, pl, 0)
+}
+
+// PutIfMissingWithTTL behaves like PutIfMissing, but additionally schedules
+// key to be proactively evicted after ttl has elapsed since its last access,
+// freeing memory for predicates that are hot briefly and then go cold. A
+// ttl <= 0 falls back to the cache's default TTL, if any was set via
+// SetDefaultTTL; if that's also zero, the entry never expires on its own.
+func (lc *listCache) PutIfMissingWithTTL(key string, pl *List, ttl time.Duration) (res *List) {
+	return lc.putIfMissing(key, pl, ttl)
+}
+
+func (lc *listCache) putIfMissing(key string, pl *List, ttl time.Duration) (res *List) {
+	if ttl <= 0 {
+		ttl = time.Duration(atomic.LoadInt64(&lc.defaultTTL))
+	}
+
 	id := farm.Fingerprint32([]byte(key)) % 64
 	c := lc.shards[id]
 
 	c.Lock()
 	defer c.Unlock()
 
+	if c.admission != nil {
+		c.admission.Record(key)
+	}
+
 	if ee, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ee)
-		res = ee.Value.(*entry).pl
-		return res
+		e := ee.Value.(*entry)
+		if c.policy == PolicySieve {
+			atomic.StoreInt32(&e.visited, 1)
+		} else {
+			c.ll.MoveToFront(ee)
+		}
+		if e.ttl > 0 {
+			c.wheel.schedule(key, e.ttl)
+		}
+		return e.pl
+	}
+
+	if c.admission != nil && c.MaxEntries > 0 && c.ll.Len() >= c.MaxEntries {
+		if victim := c.evictionCandidate(); victim != nil {
+			if c.admission.Estimate(victim.key) > c.admission.Estimate(key) {
+				// The entry we'd have to evict to make room is hotter than
+				// the newcomer; reject the newcomer instead of polluting
+				// the cache with it.
+				return pl
+			}
+		}
 	}
 
 	e := &entry{
 		key: key,
 		pl:  pl,
+		ttl: ttl,
 	}
 	ele := c.ll.PushFront(e)
 	c.cache[key] = ele
+	if ttl > 0 {
+		c.wheel.schedule(key, ttl)
+	}
 
 	return e.pl
 }
 
+// evictionCandidate returns, without removing it, the entry that the next
+// eviction pass would consider first: the LRU tail, or the SIEVE entry
+// currently under the hand.
+func (c *shard) evictionCandidate() *entry {
+	if c.policy == PolicySieve {
+		ele := c.hand
+		if ele == nil {
+			ele = c.ll.Back()
+		}
+		if ele == nil {
+			return nil
+		}
+		return ele.Value.(*entry)
+	}
+	if ele := c.ll.Back(); ele != nil {
+		return ele.Value.(*entry)
+	}
+	return nil
+}
+
 func (c *listCache) removeOldestLoop() {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
@@ -131,6 +264,52 @@ func (c *listCache) removeOldestLoop() {
 	}
 }
 
+// removeExpiredLoop advances every shard's timing wheel by one tick each
+// second and evicts whatever expired. This runs independently of, and
+// composes with, the LRU/SIEVE eviction in removeOldestLoop: the wheel gives
+// operators a second lever for memory control on read-mostly workloads with
+// strong temporal locality, on top of the usual capacity-based eviction.
+func (lc *listCache) removeExpiredLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, c := range lc.shards {
+			c.removeExpired()
+		}
+		if atomic.LoadInt32(&lc.done) > 0 {
+			return
+		}
+	}
+}
+
+func (c *shard) removeExpired() {
+	expired := c.wheel.advance()
+	if len(expired) == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for _, key := range expired {
+		ele, ok := c.cache[key]
+		if !ok {
+			continue
+		}
+		e := ele.Value.(*entry)
+		if !e.pl.SetForDeletion() {
+			// Pending mutations; leave it for the next TTL round.
+			c.wheel.schedule(key, e.ttl)
+			continue
+		}
+		delete(c.cache, key)
+		if ele == c.hand {
+			c.hand = ele.Prev()
+		}
+		c.ll.Remove(ele)
+	}
+}
+
 func (lc *listCache) removeOldest(i int) {
 	c := lc.shards[i]
 	c.Lock()
@@ -149,6 +328,11 @@ func (lc *listCache) removeOldest(i int) {
 
 	// Allow 10ms out of every second for removal.
 	deadline := start.Add(10 * time.Millisecond)
+	if c.policy == PolicySieve {
+		c.removeOldestSieve(deadline)
+		return
+	}
+
 	for c.ll.Len() > c.MaxEntries && time.Now().Before(deadline) {
 		ele := c.ll.Back()
 		if ele == nil {
@@ -175,21 +359,115 @@ func (lc *listCache) removeOldest(i int) {
 	}
 }
 
+// removeOldestSieve evicts entries using SIEVE: the hand walks backward from
+// the tail, clearing visited bits until it finds an unvisited entry, which
+// becomes the victim. Unlike LRU, hits never move list elements; the list
+// only changes on insertion and removal.
+func (c *shard) removeOldestSieve(deadline time.Time) {
+	for c.ll.Len() > c.MaxEntries && time.Now().Before(deadline) {
+		if c.hand == nil {
+			c.hand = c.ll.Back()
+		}
+		ele := c.hand
+		if ele == nil {
+			break
+		}
+		e := ele.Value.(*entry)
+
+		if atomic.LoadInt32(&e.visited) == 1 {
+			atomic.StoreInt32(&e.visited, 0)
+			c.hand = ele.Prev()
+			if c.hand == nil {
+				c.hand = c.ll.Back()
+			}
+			continue
+		}
+
+		if !e.pl.SetForDeletion() {
+			// Pending mutations; skip this candidate and move the hand on.
+			c.hand = ele.Prev()
+			if c.hand == nil {
+				c.hand = c.ll.Back()
+			}
+			continue
+		}
+
+		delete(c.cache, e.key)
+		prev := ele.Prev()
+		c.ll.Remove(ele)
+		if prev == nil {
+			prev = c.ll.Back()
+		}
+		c.hand = prev
+	}
+}
+
 // Get looks up a key's value from the cache.
 func (lc *listCache) Get(key string) (pl *List) {
 	i := farm.Fingerprint32([]byte(key)) % 64
 	c := lc.shards[i]
+
+	if c.admission != nil {
+		c.admission.Record(key)
+	}
+
+	if c.policy == PolicySieve {
+		// SIEVE hits never splice the list, so concurrent readers only need
+		// to agree on the visited bit, which is updated atomically. The bit
+		// must be set before releasing the lock, not after: removeOldestSieve
+		// takes the write lock to evict, and checks this same bit to decide
+		// whether an entry survives. Setting it after RUnlock would leave a
+		// window where eviction can run, see visited still at 0, and evict
+		// the very entry this call is about to return to its caller.
+		c.RLock()
+		ele, hit := c.cache[key]
+		if hit {
+			atomic.StoreInt32(&ele.Value.(*entry).visited, 1)
+		}
+		c.RUnlock()
+		if !hit {
+			atomic.AddUint64(&c.misses, 1)
+			return nil
+		}
+		atomic.AddUint64(&c.hits, 1)
+		e := ele.Value.(*entry)
+		if e.ttl > 0 {
+			c.wheel.schedule(key, e.ttl)
+		}
+		return e.pl
+	}
+
 	c.Lock()
 	defer c.Unlock()
 
 	if ele, hit := c.cache[key]; hit {
+		atomic.AddUint64(&c.hits, 1)
 		c.ll.MoveToFront(ele)
 		e := ele.Value.(*entry)
+		if e.ttl > 0 {
+			c.wheel.schedule(key, e.ttl)
+		}
 		return e.pl
 	}
+	atomic.AddUint64(&c.misses, 1)
 	return nil
 }
 
+// HitRatio returns the fraction of Get calls across all shards that were
+// cache hits since the cache was created, for comparing policies in A/B
+// tests. It returns 0 if there have been no lookups yet.
+func (lc *listCache) HitRatio() float64 {
+	var hits, misses uint64
+	for _, c := range lc.shards {
+		hits += atomic.LoadUint64(&c.hits)
+		misses += atomic.LoadUint64(&c.misses)
+	}
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
 // Len returns the number of items in the cache.
 // func (c *listCache) Stats() CacheStats {
 // 	c.Lock()
@@ -255,7 +533,14 @@ func (lc *listCache) delete(key []byte) {
 	defer c.Unlock()
 
 	if ele, ok := c.cache[string(key)]; ok {
+		if ele == c.hand {
+			// Keep SIEVE's hand from being left pointing at the node we're
+			// about to detach; removeOldestSieve/removeExpired apply this
+			// same fixup before removing.
+			c.hand = ele.Prev()
+		}
 		c.ll.Remove(ele)
 		delete(c.cache, string(key))
+		c.wheel.unschedule(string(key))
 	}
 }
@@ -0,0 +1,150 @@
+package posting
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// newTestSieveShard builds a bare shard for exercising removeOldestSieve
+// directly, without the background goroutines a full listCache starts.
+func newTestSieveShard(maxEntries int) *shard {
+	return &shard{
+		MaxEntries: maxEntries,
+		policy:     PolicySieve,
+		ll:         list.New(),
+		cache:      make(map[string]*list.Element),
+	}
+}
+
+func (c *shard) put(key string) *list.Element {
+	e := &entry{key: key, pl: &List{}}
+	ele := c.ll.PushFront(e)
+	c.cache[key] = ele
+	return ele
+}
+
+// TestSieveSkipsVisitedEntryGivingSecondChance verifies SIEVE's defining
+// behavior: when the hand lands on a visited entry, it clears the bit and
+// gives it a second chance instead of evicting it, moving on to the next
+// candidate.
+func TestSieveSkipsVisitedEntryGivingSecondChance(t *testing.T) {
+	c := newTestSieveShard(2)
+	c.put("a") // pushed first, so it starts at the tail where the hand begins.
+	c.put("b")
+	c.put("c")
+
+	aEle := c.cache["a"]
+	atomic.StoreInt32(&aEle.Value.(*entry).visited, 1)
+
+	c.removeOldestSieve(time.Now().Add(time.Second))
+
+	if len(c.cache) != 2 {
+		t.Fatalf("expected cache to shrink to MaxEntries=2, got %d", len(c.cache))
+	}
+	if _, ok := c.cache["a"]; !ok {
+		t.Fatalf("expected visited entry 'a' to survive its first eviction pass")
+	}
+	if atomic.LoadInt32(&aEle.Value.(*entry).visited) != 0 {
+		t.Fatalf("expected 'a' to lose its visited bit after surviving a pass")
+	}
+	if _, ok := c.cache["b"]; ok {
+		t.Fatalf("expected unvisited entry 'b' to be the one evicted")
+	}
+}
+
+// TestDeleteFixesUpDanglingSieveHand reproduces a predicate-drop-style
+// explicit delete() racing the SIEVE hand: if delete() doesn't fix up
+// c.hand the way removeOldestSieve/removeExpired do, the hand is left
+// pointing at a detached list element. Re-inserting a fresh value under the
+// same key afterwards, then running eviction, corrupts the map/list length
+// invariant: the stale element's key gets deleted from the cache map a
+// second time (for free, without shrinking the list), causing eviction to
+// run one extra real iteration, evict a second legitimate entry, and strand
+// an orphaned node in the list forever.
+func TestDeleteFixesUpDanglingSieveHand(t *testing.T) {
+	lc := newListCacheWithPolicy(1, PolicySieve)
+
+	// Find two keys that land in the same shard, so they interact.
+	keyA := "key-0"
+	shardIdx := farm.Fingerprint32([]byte(keyA)) % 64
+	var keyB string
+	for i := 1; ; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		if farm.Fingerprint32([]byte(k))%64 == shardIdx {
+			keyB = k
+			break
+		}
+	}
+	c := lc.shards[shardIdx]
+
+	lc.PutIfMissing(keyA, &List{})
+	lc.PutIfMissing(keyB, &List{})
+
+	// Simulate the hand having stopped on keyA during a prior pass.
+	c.hand = c.cache[keyA]
+
+	// A predicate drop / explicit invalidation removes keyA while the hand
+	// still points at it.
+	lc.delete([]byte(keyA))
+
+	// Re-insert a fresh value under the same key, as a later write would.
+	lc.PutIfMissing(keyA, &List{})
+
+	// One genuine eviction is due (2 live entries, MaxEntries=1).
+	lc.removeOldest(int(shardIdx))
+
+	if len(c.cache) != c.ll.Len() {
+		t.Fatalf("cache map and list length diverged: len(cache)=%d, ll.Len()=%d",
+			len(c.cache), c.ll.Len())
+	}
+	if len(c.cache) != 1 {
+		t.Fatalf("expected exactly 1 entry to survive eviction with MaxEntries=1, got %d", len(c.cache))
+	}
+}
+
+// TestSieveConcurrentGetDuringEviction exercises Get running concurrently
+// with eviction under PolicySieve. It mainly exists to be run with
+// `go test -race`: before the visited bit was set under the same RLock that
+// reads the entry, a concurrent removeOldestSieve could evict an entry in
+// the window between Get's RUnlock and its visited-bit write.
+func TestSieveConcurrentGetDuringEviction(t *testing.T) {
+	lc := newListCacheWithPolicy(50, PolicySieve)
+
+	keys := make([]string, 500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		lc.PutIfMissing(keys[i], &List{})
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					for _, k := range keys {
+						lc.Get(k)
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 64; i++ {
+		lc.removeOldest(i % len(lc.shards))
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Modified by Dgraph Labs, Inc.
+
+package posting
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// offHeapRecordHeader is fingerprint(8) + length(4) + timestamp(8), written
+// ahead of every marshaled posting list in an arena.
+const offHeapRecordHeader = 20
+
+// offHeapShard is a single pre-allocated append-only ring buffer ("arena").
+// Entries are serialized posting lists; the map from fingerprint to offset
+// holds only integers, so the GC never has to scan it or the arena itself.
+type offHeapShard struct {
+	sync.Mutex
+
+	buf     []byte
+	head    uint32
+	offsets map[uint64]uint32
+}
+
+// offHeapListCache is an alternative listCache backend that keeps posting
+// lists serialized in large byte arenas instead of as live *List values, to
+// keep them off the Go heap and out of GC scans. It trades per-Get
+// marshal/unmarshal cost for materially shorter GC pauses on nodes holding
+// millions of posting lists.
+//
+// This is NOT a drop-in replacement for listCache's mutation semantics.
+// listCache hands every caller the same *List, so a mutation one goroutine
+// applies (and the SetForDeletion-gated pending-mutation check that guards
+// eviction) is immediately visible to every other holder of that key.
+// offHeapListCache deserializes a fresh, independent *List on every Get and
+// PutIfMissing hit, so two concurrent readers of the same key get distinct
+// objects, and a mutation applied to one is invisible to the other once it's
+// round-tripped through the arena. It's only safe to use where callers treat
+// the returned *List as a read-only, point-in-time snapshot; it must not
+// back a cache whose callers rely on shared, in-place mutation.
+//
+// Callers select this backend via ActiveCacheBackend and newConfiguredCache
+// rather than constructing it directly.
+type offHeapListCache struct {
+	shards []*offHeapShard
+}
+
+// CacheBackend selects which postingCache implementation newConfiguredCache
+// constructs.
+type CacheBackend int
+
+const (
+	// CacheBackendOnHeap builds a listCache, keeping posting lists as live
+	// *List values. This is the default.
+	CacheBackendOnHeap CacheBackend = iota
+	// CacheBackendOffHeap builds an offHeapListCache, keeping posting lists
+	// serialized in byte arenas. See offHeapListCache's doc for the
+	// shared-mutation caveat before switching to it.
+	CacheBackendOffHeap
+)
+
+// ActiveCacheBackend is the backend newConfiguredCache builds. It isn't
+// read from a startup flag in this source slice - there's no config package
+// wiring it up yet - but it gives that wiring a real place to land: a
+// --cache superflag handler elsewhere in the binary only needs to set this
+// before the cache is constructed.
+var ActiveCacheBackend = CacheBackendOnHeap
+
+// postingCache is the surface both listCache and offHeapListCache
+// implement, letting newConfiguredCache's caller stay agnostic about which
+// backend it got.
+type postingCache interface {
+	PutIfMissing(key string, pl *List) *List
+	Get(key string) *List
+}
+
+// newConfiguredCache constructs whichever backend ActiveCacheBackend
+// currently selects. maxEntries sizes the on-heap backend; maxBytes sizes
+// the off-heap arena backend.
+func newConfiguredCache(maxEntries int, maxBytes uint64) postingCache {
+	switch ActiveCacheBackend {
+	case CacheBackendOffHeap:
+		return newOffHeapListCache(maxBytes)
+	default:
+		return newListCache(maxEntries)
+	}
+}
+
+// newOffHeapListCache creates an off-heap cache with maxBytes split evenly
+// across 64 shards, matching the sharding used by newListCache.
+func newOffHeapListCache(maxBytes uint64) *offHeapListCache {
+	lc := &offHeapListCache{}
+	perShard := maxBytes / 64
+	for i := 0; i < 64; i++ {
+		lc.shards = append(lc.shards, &offHeapShard{
+			buf:     make([]byte, perShard),
+			offsets: make(map[uint64]uint32),
+		})
+	}
+	return lc
+}
+
+// PutIfMissing marshals pl and copies it into the arena, returning the
+// cached value if the key was already present. If pl is too large to fit in
+// the arena at all, it's returned uncached rather than erroring, mirroring
+// listCache's "best effort" caching semantics.
+func (lc *offHeapListCache) PutIfMissing(key string, pl *List) *List {
+	fp := farm.Fingerprint64([]byte(key))
+	s := lc.shards[fp%64]
+
+	s.Lock()
+	defer s.Unlock()
+
+	if data, ok := s.lookup(fp); ok {
+		if existing, err := ReadPostingList([]byte(key), data); err == nil {
+			return existing
+		}
+	}
+
+	data, err := pl.Marshal()
+	if err != nil {
+		return pl
+	}
+	s.put(fp, data)
+	return pl
+}
+
+// Get looks up key, deserializing a fresh *List from the arena on a hit.
+func (lc *offHeapListCache) Get(key string) *List {
+	fp := farm.Fingerprint64([]byte(key))
+	s := lc.shards[fp%64]
+
+	s.Lock()
+	data, ok := s.lookup(fp)
+	s.Unlock()
+	if !ok {
+		return nil
+	}
+
+	pl, err := ReadPostingList([]byte(key), data)
+	if err != nil {
+		return nil
+	}
+	return pl
+}
+
+// lookup returns a copy of the payload bytes stored for fp, or false if
+// absent or stale (the slot was overwritten by a later wrap of the ring
+// buffer). Stale entries are deleted lazily, on the read that discovers
+// them, rather than proactively at wrap time.
+func (s *offHeapShard) lookup(fp uint64) ([]byte, bool) {
+	off, ok := s.offsets[fp]
+	if !ok {
+		return nil, false
+	}
+
+	if off+offHeapRecordHeader > uint32(len(s.buf)) {
+		delete(s.offsets, fp)
+		return nil, false
+	}
+	storedFP := binary.LittleEndian.Uint64(s.buf[off:])
+	if storedFP != fp {
+		delete(s.offsets, fp)
+		return nil, false
+	}
+	length := binary.LittleEndian.Uint32(s.buf[off+8:])
+	start := off + offHeapRecordHeader
+	if uint64(start)+uint64(length) > uint64(len(s.buf)) {
+		delete(s.offsets, fp)
+		return nil, false
+	}
+
+	data := make([]byte, length)
+	copy(data, s.buf[start:start+length])
+	return data, true
+}
+
+// put appends fp's record to the arena, wrapping to the start and evicting
+// whatever the new write overlaps when there isn't room left at the tail.
+func (s *offHeapShard) put(fp uint64, data []byte) {
+	total := uint32(offHeapRecordHeader + len(data))
+	if total > uint32(len(s.buf)) {
+		// Doesn't fit in the arena at all; skip caching this entry.
+		return
+	}
+	if s.head+total > uint32(len(s.buf)) {
+		s.head = 0
+	}
+
+	start := s.head
+	binary.LittleEndian.PutUint64(s.buf[start:], fp)
+	binary.LittleEndian.PutUint32(s.buf[start+8:], uint32(len(data)))
+	binary.LittleEndian.PutUint64(s.buf[start+12:], uint64(time.Now().UnixNano()))
+	copy(s.buf[start+offHeapRecordHeader:], data)
+
+	s.offsets[fp] = start
+	s.head = start + total
+}
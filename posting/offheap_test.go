@@ -0,0 +1,105 @@
+package posting
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// TestOffHeapShardPutLookupRoundTrip exercises the arena's raw byte-offset
+// logic directly, independent of List (de)serialization: what's read back
+// for a key must be exactly what was written for it.
+func TestOffHeapShardPutLookupRoundTrip(t *testing.T) {
+	s := &offHeapShard{buf: make([]byte, 4096), offsets: make(map[uint64]uint32)}
+
+	want := []byte("a marshaled posting list, or a stand-in for one")
+	s.put(1, want)
+
+	got, ok := s.lookup(1)
+	if !ok {
+		t.Fatalf("expected key 1 to be found")
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("lookup returned %q, want %q", got, want)
+	}
+
+	if _, ok := s.lookup(2); ok {
+		t.Fatalf("expected key 2, which was never written, to be absent")
+	}
+}
+
+// TestOffHeapShardWraparoundEvictsStaleEntries verifies that once the ring
+// buffer wraps and overwrites an older record, a lookup for that record's
+// key is treated as a miss (and the stale offset is cleaned up) rather than
+// returning the new record's bytes under the old key, or garbage.
+func TestOffHeapShardWraparoundEvictsStaleEntries(t *testing.T) {
+	const recordSize = offHeapRecordHeader + 8 // 8-byte payloads below.
+	s := &offHeapShard{buf: make([]byte, recordSize*2), offsets: make(map[uint64]uint32)}
+
+	first := bytes.Repeat([]byte{0xAA}, 8)
+	second := bytes.Repeat([]byte{0xBB}, 8)
+	third := bytes.Repeat([]byte{0xCC}, 8)
+
+	s.put(1, first)
+	s.put(2, second)
+	// The arena only fits two records; this wraps and overwrites fp=1's slot.
+	s.put(3, third)
+
+	if _, ok := s.lookup(1); ok {
+		t.Fatalf("expected key 1's slot to have been overwritten by the wrap")
+	}
+	if got, ok := s.lookup(2); !ok || !bytes.Equal(got, second) {
+		t.Fatalf("expected key 2 to survive the wrap untouched, got %q, ok=%v", got, ok)
+	}
+	if got, ok := s.lookup(3); !ok || !bytes.Equal(got, third) {
+		t.Fatalf("expected key 3 to read back what was just written, got %q, ok=%v", got, ok)
+	}
+	if _, stillTracked := s.offsets[1]; stillTracked {
+		t.Fatalf("expected the stale offset for key 1 to be cleaned up by lookup")
+	}
+}
+
+// TestNewConfiguredCacheSelectsBackend verifies newConfiguredCache builds
+// the backend ActiveCacheBackend names, rather than always defaulting to
+// the on-heap one.
+func TestNewConfiguredCacheSelectsBackend(t *testing.T) {
+	old := ActiveCacheBackend
+	defer func() { ActiveCacheBackend = old }()
+
+	ActiveCacheBackend = CacheBackendOnHeap
+	if _, ok := newConfiguredCache(10, 0).(*listCache); !ok {
+		t.Fatalf("expected CacheBackendOnHeap to build a *listCache")
+	}
+
+	ActiveCacheBackend = CacheBackendOffHeap
+	if _, ok := newConfiguredCache(10, 4096).(*offHeapListCache); !ok {
+		t.Fatalf("expected CacheBackendOffHeap to build an *offHeapListCache")
+	}
+}
+
+// BenchmarkListCacheHeap benchmarks the default on-heap listCache under
+// sustained insert pressure, reporting allocations per op via ReportAllocs
+// so it can be compared against BenchmarkListCacheOffHeap.
+func BenchmarkListCacheHeap(b *testing.B) {
+	lc := newListCache(100000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("pred-%d", i)
+		lc.PutIfMissing(key, &List{})
+	}
+}
+
+// BenchmarkListCacheOffHeap benchmarks the arena-backed offHeapListCache
+// under the same workload, also reporting allocations per op. Its *List
+// allocations are transient (unreferenced once marshaled into the arena);
+// the benchmark does not measure live heap or GC pause times.
+func BenchmarkListCacheOffHeap(b *testing.B) {
+	lc := newOffHeapListCache(64 << 20) // 64MB arena budget.
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("pred-%d", i)
+		lc.PutIfMissing(key, &List{})
+	}
+	runtime.KeepAlive(lc)
+}
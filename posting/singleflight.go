@@ -0,0 +1,93 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Modified by Dgraph Labs, Inc.
+
+package posting
+
+import (
+	"sync"
+	"sync/atomic"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// call represents an in-flight or completed GetOrLoad loader invocation that
+// other callers for the same key can wait on, the classic singleflight
+// pattern (as used in groupcache).
+type call struct {
+	wg  sync.WaitGroup
+	pl  *List
+	err error
+}
+
+// GetOrLoad returns the cached value for key, loading it via loader on a
+// miss. When many goroutines miss on the same key concurrently - e.g. a hot
+// predicate falling out of cache under a burst of readers - only the first
+// one runs loader; the rest block on its result instead of each hitting
+// Badger independently.
+//
+// Converting the package's own Get/GetNoStore call sites to route through
+// GetOrLoad is not done by this change: those functions carry read-ts,
+// transaction, and memory-only handling that isn't present in this source
+// slice, and stubbing them out here would just hide that gap behind
+// placeholder globals. This ships GetOrLoad as a cache-level primitive,
+// exercised directly by TestGetOrLoadCoalescesConcurrentMisses; wiring it
+// into Get/GetNoStore is left to whoever owns those implementations.
+func (lc *listCache) GetOrLoad(key string, loader func() (*List, error)) (*List, error) {
+	if pl := lc.Get(key); pl != nil {
+		return pl, nil
+	}
+
+	id := farm.Fingerprint32([]byte(key)) % 64
+	c := lc.shards[id]
+
+	c.inflightMu.Lock()
+	if cl, ok := c.inflight[key]; ok {
+		c.inflightMu.Unlock()
+		atomic.AddUint64(&c.coalesced, 1)
+		cl.wg.Wait()
+		return cl.pl, cl.err
+	}
+	cl := &call{}
+	cl.wg.Add(1)
+	c.inflight[key] = cl
+	c.inflightMu.Unlock()
+
+	pl, err := loader()
+	if err == nil {
+		pl = lc.PutIfMissing(key, pl)
+	}
+	cl.pl, cl.err = pl, err
+
+	c.inflightMu.Lock()
+	delete(c.inflight, key)
+	c.inflightMu.Unlock()
+	cl.wg.Done()
+
+	return pl, err
+}
+
+// CoalescedLoads returns the number of GetOrLoad calls across all shards
+// that were satisfied by an in-flight load rather than invoking loader
+// themselves, for monitoring stampede suppression.
+func (lc *listCache) CoalescedLoads() uint64 {
+	var total uint64
+	for _, c := range lc.shards {
+		total += atomic.LoadUint64(&c.coalesced)
+	}
+	return total
+}
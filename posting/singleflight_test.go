@@ -0,0 +1,39 @@
+package posting
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoadCoalescesConcurrentMisses(t *testing.T) {
+	lc := newListCache(100)
+
+	var loads int32
+	loader := func() (*List, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(20 * time.Millisecond)
+		return &List{}, nil
+	}
+
+	var wg sync.WaitGroup
+	const goroutines = 1000
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := lc.GetOrLoad("hot-key", loader); err != nil {
+				t.Errorf("GetOrLoad: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&loads); got != 1 {
+		t.Fatalf("expected exactly 1 loader invocation, got %d", got)
+	}
+	if got := lc.CoalescedLoads(); got == 0 {
+		t.Fatalf("expected some GetOrLoad calls to be reported as coalesced, got 0")
+	}
+}
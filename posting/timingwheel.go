@@ -0,0 +1,102 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Modified by Dgraph Labs, Inc.
+
+package posting
+
+import (
+	"sync"
+	"time"
+)
+
+// wheelSlots is the number of one-second slots in the timing wheel, giving a
+// maximum expressible TTL of 5 minutes per tick before a key needs
+// rescheduling. That's plenty for the "hot predicate, then cold" pattern
+// this is meant for; callers wanting longer TTLs just get clamped to it.
+const wheelSlots = 300
+
+// timingWheel is a hashed timing wheel used to expire listCache entries
+// after a per-key TTL. Each shard owns one; a single background goroutine
+// advances every shard's wheel once a second.
+type timingWheel struct {
+	mu   sync.Mutex
+	cur  int
+	slot [wheelSlots][]string
+	pos  map[string]int
+}
+
+func newTimingWheel() *timingWheel {
+	return &timingWheel{pos: make(map[string]int)}
+}
+
+// schedule (re)schedules key to expire after ttl, rounded up to the nearest
+// second and clamped to the wheel's range. Rescheduling an already-scheduled
+// key is how Get implements sliding expiration: its old slot entry becomes
+// stale and is ignored when that slot is eventually processed.
+//
+// advance() processes slot w.cur and only then moves w.cur forward, so a key
+// that must survive exactly ticks more advance() calls belongs in slot
+// w.cur+ticks-1: the call that lands on w.cur+ticks-1 is the ticks'th call
+// since scheduling. Using w.cur+ticks instead would make every TTL fire one
+// tick late.
+func (w *timingWheel) schedule(key string, ttl time.Duration) {
+	ticks := int((ttl + time.Second - 1) / time.Second)
+	if ticks < 1 {
+		ticks = 1
+	}
+	if ticks > wheelSlots {
+		ticks = wheelSlots
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	slot := (w.cur + ticks - 1) % wheelSlots
+	w.slot[slot] = append(w.slot[slot], key)
+	w.pos[key] = slot
+}
+
+// unschedule drops key's TTL, e.g. because it was explicitly deleted.
+func (w *timingWheel) unschedule(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.pos, key)
+}
+
+// advance moves the wheel forward one tick and returns the keys that
+// expired in the slot just passed, i.e. everything still recorded there
+// that hasn't since been rescheduled into a different slot.
+func (w *timingWheel) advance() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := w.cur
+	keys := w.slot[slot]
+	w.slot[slot] = nil
+	w.cur = (w.cur + 1) % wheelSlots
+
+	expired := keys[:0]
+	for _, key := range keys {
+		if s, ok := w.pos[key]; !ok || s != slot {
+			// Rescheduled into a later slot, or unscheduled, since this one
+			// was populated.
+			continue
+		}
+		delete(w.pos, key)
+		expired = append(expired, key)
+	}
+	return expired
+}
@@ -0,0 +1,35 @@
+package posting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingWheelScheduleAndAdvance(t *testing.T) {
+	w := newTimingWheel()
+	w.schedule("a", 0) // clamped to 1 tick
+	w.schedule("b", 3*time.Second)
+
+	// "a" has a 1-tick TTL, so it must expire on the very first advance().
+	if expired := w.advance(); len(expired) != 1 || expired[0] != "a" {
+		t.Fatalf("expected [a] to expire on first tick, got %v", expired)
+	}
+	// "b" has a 3-tick TTL: one tick already elapsed above, so it takes
+	// exactly 2 more advance() calls, the second of which expires it.
+	if expired := w.advance(); len(expired) != 0 {
+		t.Fatalf("expected nothing to expire yet, got %v", expired)
+	}
+	if expired := w.advance(); len(expired) != 1 || expired[0] != "b" {
+		t.Fatalf("expected [b] to expire on its tick, got %v", expired)
+	}
+}
+
+func TestTimingWheelRescheduleSupersedesOldSlot(t *testing.T) {
+	w := newTimingWheel()
+	w.schedule("a", time.Second)
+	w.schedule("a", 3*time.Second) // sliding expiration, as Get would do
+
+	if expired := w.advance(); len(expired) != 0 {
+		t.Fatalf("expected rescheduled key to not expire on its original tick, got %v", expired)
+	}
+}
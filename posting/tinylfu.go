@@ -0,0 +1,166 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Modified by Dgraph Labs, Inc.
+
+package posting
+
+import (
+	"sync"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// cmsDepth is the number of independent hash rows in the Count-Min Sketch.
+const cmsDepth = 4
+
+// tinyLFU is an admission filter for listCache: it estimates how frequently a
+// key has recently been seen so that, under memory pressure, a hot eviction
+// candidate can survive a cold newcomer instead of being unconditionally
+// displaced. It pairs a 4-bit Count-Min Sketch with a doorkeeper bloom filter
+// so one-hit wonders don't inflate the sketch. See
+// https://dgraph.io/blog/post/caching-in-dgraph (TinyLFU, Ben-Manes et al).
+type tinyLFU struct {
+	mu sync.Mutex
+
+	width   uint32
+	table   [cmsDepth][]byte // 4-bit counters, two packed per byte.
+	door    []uint64         // doorkeeper bitset, width bits.
+	samples int
+	// resetAt is the aging window: every resetAt samples, all counters are
+	// halved and the doorkeeper is cleared so the filter tracks recent
+	// activity rather than all-time frequency.
+	resetAt int
+}
+
+// newTinyLFU creates an admission filter sized for a cache holding roughly
+// maxEntries items, using a width of 8x maxEntries as recommended for
+// Count-Min Sketch accuracy at this depth.
+func newTinyLFU(maxEntries int) *tinyLFU {
+	if maxEntries <= 0 {
+		// Unlimited cache: there's no eviction pressure to admission-gate.
+		return nil
+	}
+	width := uint32(maxEntries) * 8
+	if width < 16 {
+		width = 16
+	}
+	t := &tinyLFU{
+		width:   width,
+		resetAt: maxEntries,
+	}
+	for i := range t.table {
+		t.table[i] = make([]byte, (width+1)/2)
+	}
+	t.door = make([]uint64, (uint64(width)+63)/64)
+	return t
+}
+
+func (t *tinyLFU) hash(key string, row int) uint32 {
+	h := farm.Fingerprint64([]byte(key))
+	// Mix in the row number so the four hash functions are independent.
+	h ^= (uint64(row) + 1) * 0x9E3779B97F4A7C15
+	h ^= h >> 33
+	return uint32(h % uint64(t.width))
+}
+
+func (t *tinyLFU) getCount(row int, idx uint32) uint8 {
+	b := t.table[row][idx/2]
+	if idx%2 == 0 {
+		return b & 0x0F
+	}
+	return b >> 4
+}
+
+func (t *tinyLFU) incCount(row int, idx uint32) {
+	bi := idx / 2
+	b := t.table[row][bi]
+	if idx%2 == 0 {
+		if v := b & 0x0F; v < 15 {
+			t.table[row][bi] = (b &^ 0x0F) | (v + 1)
+		}
+		return
+	}
+	if v := b >> 4; v < 15 {
+		t.table[row][bi] = (b & 0x0F) | ((v + 1) << 4)
+	}
+}
+
+func (t *tinyLFU) halve() {
+	for row := range t.table {
+		for i, b := range t.table[row] {
+			lo := (b & 0x0F) >> 1
+			hi := (b >> 4) >> 1
+			t.table[row][i] = lo | (hi << 4)
+		}
+	}
+}
+
+func (t *tinyLFU) doorTest(idx uint32) bool {
+	return t.door[idx/64]&(1<<(idx%64)) != 0
+}
+
+func (t *tinyLFU) doorSet(idx uint32) {
+	t.door[idx/64] |= 1 << (idx % 64)
+}
+
+func (t *tinyLFU) doorClear() {
+	for i := range t.door {
+		t.door[i] = 0
+	}
+}
+
+// Record registers a sighting of key, as called from both Get and
+// PutIfMissing. The first sighting only sets the doorkeeper bit; only once a
+// key has been seen twice does it start consuming sketch counters, so
+// one-hit-wonders don't crowd out genuinely hot keys.
+func (t *tinyLFU) Record(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	di := t.hash(key, 0)
+	if !t.doorTest(di) {
+		t.doorSet(di)
+	} else {
+		for row := 0; row < cmsDepth; row++ {
+			t.incCount(row, t.hash(key, row))
+		}
+	}
+
+	t.samples++
+	if t.samples >= t.resetAt {
+		t.halve()
+		t.doorClear()
+		t.samples = 0
+	}
+}
+
+// Estimate returns key's approximate recent frequency.
+func (t *tinyLFU) Estimate(key string) uint8 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	min := uint8(15)
+	for row := 0; row < cmsDepth; row++ {
+		if c := t.getCount(row, t.hash(key, row)); c < min {
+			min = c
+		}
+	}
+	if t.doorTest(t.hash(key, 0)) {
+		min++
+	}
+	return min
+}
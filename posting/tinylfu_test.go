@@ -0,0 +1,85 @@
+package posting
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// zipfKeys generates n keys drawn from a Zipfian distribution over
+// numKeys distinct values, simulating a small set of hot predicates mixed
+// into a long tail of scan-driven, rarely-repeated keys.
+func zipfKeys(n, numKeys int) []string {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.5, 1, uint64(numKeys-1))
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", z.Uint64())
+	}
+	return keys
+}
+
+// TestTinyLFUEstimateFavorsHotKeys checks that a key recorded many times
+// estimates higher than one recorded once, which is what lets the admission
+// filter keep a scan's one-hit-wonders from displacing hot entries.
+func TestTinyLFUEstimateFavorsHotKeys(t *testing.T) {
+	lfu := newTinyLFU(1024)
+
+	for i := 0; i < 20; i++ {
+		lfu.Record("hot")
+	}
+	lfu.Record("cold")
+
+	if hot, cold := lfu.Estimate("hot"), lfu.Estimate("cold"); hot <= cold {
+		t.Fatalf("expected hot key estimate (%d) > cold key estimate (%d)", hot, cold)
+	}
+}
+
+// TestListCacheScanResistance simulates a scan-heavy workload: a small set
+// of warmed-up hot keys followed by a Zipfian scan whose long tail of keys is
+// rarely repeated. Without admission control, the scan's rare keys would
+// repeatedly evict hot entries; with TinyLFU admission, hot keys should stay
+// resident.
+func TestListCacheScanResistance(t *testing.T) {
+	const maxEntries = 50
+	lc := newListCache(maxEntries)
+
+	hotKeys := make([]string, 10)
+	for i := range hotKeys {
+		hotKeys[i] = fmt.Sprintf("hot-%d", i)
+	}
+	for _, k := range hotKeys {
+		lc.PutIfMissing(k, &List{})
+		// Warm the admission filter so these keys read as frequently seen.
+		for i := 0; i < 5; i++ {
+			lc.Get(k)
+		}
+	}
+
+	// A large Zipfian scan, far bigger than the cache.
+	for _, k := range zipfKeys(5000, 100000) {
+		lc.PutIfMissing(k, &List{})
+	}
+
+	resident := 0
+	for _, k := range hotKeys {
+		if lc.Get(k) != nil {
+			resident++
+		}
+	}
+	if resident == 0 {
+		t.Fatalf("expected at least some hot keys to survive the scan, got 0 of %d", len(hotKeys))
+	}
+}
+
+// BenchmarkPutIfMissingScan benchmarks PutIfMissing under a scan-heavy
+// workload with TinyLFU admission enabled, for comparison against the
+// previous unconditional-insert behavior.
+func BenchmarkPutIfMissingScan(b *testing.B) {
+	lc := newListCache(1000)
+	keys := zipfKeys(b.N, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lc.PutIfMissing(keys[i], &List{})
+	}
+}